@@ -0,0 +1,189 @@
+//  版权 (c) 2023 Uber Technologies, Inc.
+//
+// 根据Apache许可证2.0版本（“许可证”）获得许可；
+// 除非符合许可证，否则您不得使用此文件。
+// 您可以在以下位置获取许可证副本：
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 除非适用法律要求或书面同意，否则软件
+// 按“原样”分发，不提供任何明示或暗示的保证或条件。
+// 请参阅许可证以了解管理权限和限制的特定语言。
+
+package diagnostic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// ignoreDirectivePrefix 是可以附加在诊断所在行的行内抑制注释的前缀，
+// 完整形式是`// nilaway:ignore 原因说明`。原因说明是必需的，
+// 这样团队在审查baseline/抑制时能看到为什么某处被放行；只写前缀而不写原因不会生效。
+const ignoreDirectivePrefix = "nilaway:ignore"
+
+// stepKind 按位置给nilPath或nonnilPath上的一步打标签：路径的第一步为"source"，最后一步为"sink"，
+// 其余为中间的传播步骤（"propagation"）；只有一步的路径，其唯一一步记为"source"。两条路径各自独立
+// 计算，因此nilPath的"sink"和nonnilPath的"source"并不是nil的产生处或实际解引用处。
+// 这与Fingerprint中按(producerRepr, consumerRepr, stepKind)三元组哈希的要求对应：
+// 两个生产者/消费者表示文本相同但处于路径不同位置（因而角色不同）的步骤不应被当成同一步骤。
+func stepKind(length, index int) string {
+	switch {
+	case index == 0:
+		return "source"
+	case index == length-1:
+		return "sink"
+	default:
+		return "propagation"
+	}
+}
+
+// Fingerprint 计算一个冲突的位置无关身份标识：包含冲突所在函数在包内的限定名
+// （通过enclosingFunctionName得到，与groupConflicts中用于分组单一断言冲突的是同一份逻辑）、
+// nilPath和nonnilPath上每一步的(producerRepr, consumerRepr, stepKind)有序三元组序列，
+// 以及冲突所在包的路径（与函数名合起来即该函数的完全限定身份）。行号被有意排除在外，因此与该冲突无关的编辑不会使baseline失效。
+func Fingerprint(pass *analysis.Pass, c conflict, cwd string) string {
+	h := sha256.New()
+
+	writeField := func(s string) {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+
+	writeField(pass.Pkg.Path())
+	writeField(enclosingFunctionName(pass, cwd, c.position))
+
+	for i, n := range c.flow.nilPath {
+		writeField(n.producerRepr)
+		writeField(n.consumerRepr)
+		writeField(stepKind(len(c.flow.nilPath), i))
+	}
+	for i, n := range c.flow.nonnilPath {
+		writeField(n.producerRepr)
+		writeField(n.consumerRepr)
+		writeField(stepKind(len(c.flow.nonnilPath), i))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// baselineFile 是`-nilaway-baseline`和`-nilaway-suppress`标志读写的JSON文件的形状：
+// 被放行的冲突指纹集合，外加写入时间点的人类可读位置作为审查时的参考（不参与指纹计算或匹配）。
+type baselineFile struct {
+	Conflicts []baselineEntry `json:"conflicts"`
+}
+
+type baselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	// Position 仅用于方便人工审查baseline文件，匹配时不使用。
+	Position string `json:"position"`
+	Message  string `json:"message"`
+}
+
+// FingerprintEntry 为一个冲突计算baselineEntry（指纹，以及仅供人工审查用的位置和消息）。
+func FingerprintEntry(pass *analysis.Pass, c conflict, cwd string) baselineEntry {
+	return baselineEntry{
+		Fingerprint: Fingerprint(pass, c, cwd),
+		Position:    c.position.String(),
+		Message:     c.String(),
+	}
+}
+
+// WriteBaseline 将entries写入path，供后续运行通过`-nilaway-suppress`过滤掉。
+// entries通常是跨所有包合并后、由FingerprintEntry逐个计算出来的。
+func WriteBaseline(entries []baselineEntry, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(baselineFile{Conflicts: entries})
+}
+
+// ReadSuppressions 读取一个baseline文件并返回其中记录的指纹集合，供FilterSuppressed使用。
+func ReadSuppressions(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var baseline baselineFile
+	if err := json.NewDecoder(f).Decode(&baseline); err != nil {
+		return nil, err
+	}
+
+	suppressed := make(map[string]bool, len(baseline.Conflicts))
+	for _, e := range baseline.Conflicts {
+		suppressed[e.Fingerprint] = true
+	}
+	return suppressed, nil
+}
+
+// FilterSuppressed 移除allConflicts中那些被baseline（通过指纹）或`//nilaway:ignore`行内
+// 指令放行的冲突。suppressed可以为nil，表示没有加载`-nilaway-suppress`文件。
+func FilterSuppressed(pass *analysis.Pass, allConflicts []conflict, cwd string, suppressed map[string]bool) []conflict {
+	var kept []conflict
+	for _, c := range allConflicts {
+		if suppressed[Fingerprint(pass, c, cwd)] {
+			continue
+		}
+		if hasIgnoreDirective(pass, cwd, c.position) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// hasIgnoreDirective 检查position所在行是否带有一条`// nilaway:ignore <非空原因>`行内抑制
+// 指令。匹配基于该行真正的`*ast.Comment`（而不是对源码文本做子串查找），因此不会被字符串字面量
+// 或其他位置包含同样文本的注释误伤；原因说明留空时指令不生效，以确保每处豁免都有书面理由。
+func hasIgnoreDirective(pass *analysis.Pass, cwd string, position token.Position) bool {
+	for _, file := range pass.Files {
+		fileName := pass.Fset.Position(file.FileStart).Filename
+		if fn, err := filepath.Rel(cwd, fileName); err == nil {
+			fileName = fn
+		}
+		if fileName != position.Filename {
+			continue
+		}
+
+		for _, cg := range file.Comments {
+			for _, c := range cg.List {
+				if pass.Fset.Position(c.Pos()).Line != position.Line {
+					continue
+				}
+				if _, reason, ok := parseIgnoreDirective(c.Text); ok && reason != "" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// parseIgnoreDirective 解析单条`*ast.Comment`的文本（包含前导的`//`或`/* */`），
+// 若它是`nilaway:ignore`指令则返回true和去除前缀、两端空白后的原因说明。
+func parseIgnoreDirective(commentText string) (directive string, reason string, ok bool) {
+	text := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(commentText, "//"), "/*"))
+	if !strings.HasPrefix(text, ignoreDirectivePrefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(text, ignoreDirectivePrefix)
+	if rest != "" && !strings.HasPrefix(rest, " ") && !strings.HasPrefix(rest, "\t") && !strings.HasPrefix(rest, "*/") {
+		return "", "", false
+	}
+	reason = strings.TrimSpace(strings.TrimSuffix(rest, "*/"))
+	return ignoreDirectivePrefix, reason, true
+}
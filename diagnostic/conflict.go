@@ -89,28 +89,8 @@ func groupConflicts(allConflicts []conflict, pass *analysis.Pass, cwd string) []
 				// ```
 				// 在这里，两个错误消息完全相同，但它们不应被分组在一起，因为它们来自不同的函数。
 				// 为了处理这种情况，我们将包含函数名添加到键中。
-				conf := pass.ResultOf[config.Analyzer].(*config.Config)
-				for _, file := range pass.Files {
-					// `fileName`存储相对于当前工作目录的完整文件路径
-					fileName := pass.Fset.Position(file.FileStart).Filename
-					if fn, err := filepath.Rel(cwd, fileName); err == nil {
-						fileName = fn
-					}
-					// 检查文件是否在范围内且冲突位置是否在同一文件中
-					if !conf.IsFileInScope(file) || fileName != c.position.Filename {
-						continue
-					}
-					for _, decl := range file.Decls {
-						// 检查冲突位置是否落在函数的位置范围内。如果是，则更新键以包含函数名，并结束遍历。
-						if fd, ok := decl.(*ast.FuncDecl); ok {
-							functionStart := pass.Fset.Position(fd.Pos()).Offset
-							functionEnd := pass.Fset.Position(fd.End()).Offset
-							if c.position.Offset >= functionStart && c.position.Offset <= functionEnd {
-								key = fd.Name.Name + ":" + key
-								break
-							}
-						}
-					}
+				if fn := enclosingFunctionName(pass, cwd, c.position); fn != "" {
+					key = fn + ":" + key
 				}
 			}
 		}
@@ -133,3 +113,47 @@ func groupConflicts(allConflicts []conflict, pass *analysis.Pass, cwd string) []
 	}
 	return groupedConflicts
 }
+
+// enclosingFuncDecl 返回scope内包含position的函数声明，如果该位置不在scope内任何文件的任何
+// 函数中，则返回nil。cwd用于将文件的绝对路径转换为与position.Filename可比较的相对路径。
+// 这是groupConflicts和fix.go都依赖的唯一一份"定位冲突所在函数"的逻辑，以保证scope过滤
+// （conf.IsFileInScope）在所有调用方处保持一致。
+func enclosingFuncDecl(pass *analysis.Pass, cwd string, position token.Position) *ast.FuncDecl {
+	conf := pass.ResultOf[config.Analyzer].(*config.Config)
+	for _, file := range pass.Files {
+		// `fileName`存储相对于当前工作目录的完整文件路径
+		fileName := pass.Fset.Position(file.FileStart).Filename
+		if fn, err := filepath.Rel(cwd, fileName); err == nil {
+			fileName = fn
+		}
+		// 检查文件是否在范围内且冲突位置是否在同一文件中
+		if !conf.IsFileInScope(file) || fileName != position.Filename {
+			continue
+		}
+		for _, decl := range file.Decls {
+			// 检查位置是否落在函数的位置范围内。如果是，返回该函数声明。
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				functionStart := pass.Fset.Position(fd.Pos()).Offset
+				functionEnd := pass.Fset.Position(fd.End()).Offset
+				if position.Offset >= functionStart && position.Offset <= functionEnd {
+					return fd
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// enclosingFunctionName 返回包含position的函数在包内的限定名（不含包路径），如果该位置不在scope内任何文件的
+// 任何函数中，则返回空字符串。对方法，名字会附带接收者类型（如"(*A).Get"），
+// 这样同一包内不同接收者上的同名方法不会被当成同一个函数（例如分组或指纹计算时）。
+func enclosingFunctionName(pass *analysis.Pass, cwd string, position token.Position) string {
+	fd := enclosingFuncDecl(pass, cwd, position)
+	if fd == nil {
+		return ""
+	}
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	}
+	return fmt.Sprintf("(%s).%s", exprString(fd.Recv.List[0].Type), fd.Name.Name)
+}
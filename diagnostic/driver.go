@@ -0,0 +1,115 @@
+//  版权 (c) 2023 Uber Technologies, Inc.
+//
+// 根据Apache许可证2.0版本（“许可证”）获得许可；
+// 除非符合许可证，否则您不得使用此文件。
+// 您可以在以下位置获取许可证副本：
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 除非适用法律要求或书面同意，否则软件
+// 按“原样”分发，不提供任何明示或暗示的保证或条件。
+// 请参阅许可证以了解管理权限和限制的特定语言。
+
+package diagnostic
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// outputFlag 对应`-nilaway-output`标志，形如`sarif:path.sarif`。它在每个包的`analysis.Pass`
+// 运行时都可见，但只应在进程退出前、所有包都报告完毕后由Flush消费一次。
+var outputFlag = flag.String("nilaway-output", "", "额外将所有包合并后的冲突写出的目标，形如\"sarif:path.sarif\"")
+
+// fixFlag 对应`-nilaway-fix`标志：开启后，分析器在构造每条analysis.Diagnostic时应调用
+// SuggestedFixes并把结果附加到Diagnostic.SuggestedFixes上，供`go vet -fix`/gopls应用。
+var fixFlag = flag.Bool("nilaway-fix", false, "是否为可自动修复的冲突生成analysis.SuggestedFixes")
+
+// FixEnabled 报告`-nilaway-fix`标志是否开启。
+func FixEnabled() bool {
+	return *fixFlag
+}
+
+// baselineFlag 对应`-nilaway-baseline`标志：将本次运行检测到的所有冲突的指纹写出到该路径。
+var baselineFlag = flag.String("nilaway-baseline", "", "将本次运行检测到的所有冲突的指纹写出到该路径，用作baseline")
+
+// suppressFlag 对应`-nilaway-suppress`标志：从该路径读取此前写出的baseline文件，
+// 过滤掉其中记录的冲突。
+var suppressFlag = flag.String("nilaway-suppress", "", "从该路径读取baseline文件，过滤掉其中记录的冲突")
+
+// ApplySuppressions 过滤掉conflicts中被`-nilaway-suppress`（如果设置了该标志）
+// 或`//nilaway:ignore`行内指令放行的冲突。分析器应在分组（groupConflicts）之后、
+// 报告（pass.Report）和Collect之前，对每个包的冲突调用一次。
+func ApplySuppressions(pass *analysis.Pass, conflicts []conflict, cwd string) ([]conflict, error) {
+	var suppressed map[string]bool
+	if *suppressFlag != "" {
+		var err error
+		suppressed, err = ReadSuppressions(*suppressFlag)
+		if err != nil {
+			return nil, fmt.Errorf("读取nilaway-suppress失败: %w", err)
+		}
+	}
+	return FilterSuppressed(pass, conflicts, cwd, suppressed), nil
+}
+
+// collectedConflict 记录一个冲突及其产生时所在的`analysis.Pass`和cwd，
+// 因为Fingerprint和enclosingFuncDecl都需要冲突所属包的Pass才能正确解析。
+type collectedConflict struct {
+	pass *analysis.Pass
+	c    conflict
+	cwd  string
+}
+
+var (
+	collectedMu sync.Mutex
+	collected   []collectedConflict
+)
+
+// Collect 记录一个包分析产生的（已分组、已按需过滤的）冲突，供进程退出前Flush合并输出。
+// 由于`go/analysis`的driver可能并发运行多个包的分析，这里用互斥锁保护累积状态。
+// 分析器应在每个包的Run中、报告冲突之后调用一次。
+func Collect(pass *analysis.Pass, conflicts []conflict, cwd string) {
+	collectedMu.Lock()
+	defer collectedMu.Unlock()
+	for _, c := range conflicts {
+		collected = append(collected, collectedConflict{pass: pass, c: c, cwd: cwd})
+	}
+}
+
+// Flush 在所有包分析完成、进程退出前调用一次：合并所有包通过Collect提交的冲突，
+// 按需写出`-nilaway-output`请求的结构化输出文件和`-nilaway-baseline`请求的baseline文件。
+// 这是`singlechecker`/`multichecker`包装器cmd在main返回前应调用的收尾步骤。
+func Flush() error {
+	collectedMu.Lock()
+	defer collectedMu.Unlock()
+
+	if *outputFlag != "" {
+		allConflicts := make([]conflict, 0, len(collected))
+		for _, cc := range collected {
+			allConflicts = append(allConflicts, cc.c)
+		}
+
+		mode, err := ParseOutputFlag(*outputFlag)
+		if err != nil {
+			return err
+		}
+		if err := mode.Write(allConflicts); err != nil {
+			return fmt.Errorf("写出nilaway-output失败: %w", err)
+		}
+	}
+
+	if *baselineFlag != "" {
+		entries := make([]baselineEntry, 0, len(collected))
+		for _, cc := range collected {
+			entries = append(entries, FingerprintEntry(cc.pass, cc.c, cc.cwd))
+		}
+		if err := WriteBaseline(entries, *baselineFlag); err != nil {
+			return fmt.Errorf("写出nilaway-baseline失败: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+//  版权 (c) 2023 Uber Technologies, Inc.
+//
+// 根据Apache许可证2.0版本（“许可证”）获得许可；
+// 除非符合许可证，否则您不得使用此文件。
+// 您可以在以下位置获取许可证副本：
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 除非适用法律要求或书面同意，否则软件
+// 按“原样”分发，不提供任何明示或暗示的保证或条件。
+// 请参阅许可证以了解管理权限和限制的特定语言。
+
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// identifierInBackticks 匹配诊断文案中用反引号包裹的标识符，例如"本地变量 `mp`"。
+var identifierInBackticks = regexp.MustCompile("`([^`]+)`")
+
+// extractIdentifier 从诊断表示文本中取出反引号包裹的标识符名，用于合成`if x == nil`里的`x`。
+func extractIdentifier(repr string) (string, bool) {
+	m := identifierInBackticks.FindStringSubmatch(repr)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// enclosingStmt 返回fd函数体中包含position的最内层语句。对于我们这里要生成修复的冲突，
+// position是解引用/使用发生的地方，而不是引入该变量的地方；调用方需要再用definingStmt
+// 回溯到真正应该被改写的语句。
+func enclosingStmt(pass *analysis.Pass, fd *ast.FuncDecl, position token.Position) ast.Stmt {
+	var found ast.Stmt
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		stmt, ok := n.(ast.Stmt)
+		if !ok {
+			return true
+		}
+		start := pass.Fset.Position(stmt.Pos()).Offset
+		end := pass.Fset.Position(stmt.End()).Offset
+		if position.Offset >= start && position.Offset <= end {
+			found = stmt
+		}
+		return true
+	})
+	return found
+}
+
+// definingStmt 在fd函数体中查找在beforeOffset之前最近的一条为varName赋值的`:=`语句
+// （`v := m[k]`、`x := i.(T)`等我们知道如何改写的模式都是这种形状）。
+// 只考虑严格位于beforeOffset（解引用语句的起点）之前的语句，所以即使解引用语句本身是`y := *v`
+// 这样的`:=`也不会被选中；mapOkCheckFix/typeAssertOkCheckFix作用在这里找到的定义语句上，而不是解引用语句上。
+// 找不到时返回nil，调用方应退回到在解引用点之前插入nil防护。
+func definingStmt(pass *analysis.Pass, fd *ast.FuncDecl, varName string, beforeOffset int) *ast.AssignStmt {
+	var best *ast.AssignStmt
+	bestOffset := -1
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE {
+			return true
+		}
+		offset := pass.Fset.Position(assign.Pos()).Offset
+		if offset >= beforeOffset || offset <= bestOffset {
+			return true
+		}
+		for _, lhs := range assign.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok && id.Name == varName {
+				best = assign
+				bestOffset = offset
+				break
+			}
+		}
+		return true
+	})
+	return best
+}
+
+// innermostFuncType 返回fd中、直接或通过嵌套的`*ast.FuncLit`间接包含position的最内层函数的
+// 返回值列表。解引用如果发生在闭包内部，闭包的签名可能与外层函数完全不同，此时必须用闭包自己
+// 的返回值列表合成`return`，否则生成的返回语句的元数/类型都会与所在函数对不上。
+func innermostFuncType(pass *analysis.Pass, fd *ast.FuncDecl, position token.Position) *ast.FieldList {
+	results := fd.Type.Results
+	bestSpan := pass.Fset.Position(fd.End()).Offset - pass.Fset.Position(fd.Pos()).Offset
+
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		lit, ok := n.(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+		start := pass.Fset.Position(lit.Pos()).Offset
+		end := pass.Fset.Position(lit.End()).Offset
+		if position.Offset < start || position.Offset > end {
+			return true
+		}
+		if span := end - start; span < bestSpan {
+			bestSpan = span
+			results = lit.Type.Results
+		}
+		return true
+	})
+	return results
+}
+
+// isMapIndex 报告idx是否是对map的索引（而不是对slice/array的索引，那种情形没有comma-ok形式）。
+// 判断依赖pass.TypesInfo，而不是idx本身的语法形状，因为`s[i]`和`m[k]`在AST层面都是*ast.IndexExpr。
+func isMapIndex(pass *analysis.Pass, idx *ast.IndexExpr) bool {
+	if pass.TypesInfo == nil {
+		return false
+	}
+	t := pass.TypesInfo.TypeOf(idx.X)
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Map)
+	return ok
+}
+
+// exprString 将一个表达式打印回Go源码文本，用于在合成的修复文本中复用已有的类型/表达式拼写。
+func exprString(e ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, token.NewFileSet(), e)
+	return buf.String()
+}
+
+// basicNumericTypes 是go/ast.Ident可能命名的预声明数值类型，用于zeroValueExpr合成"0"。
+var basicNumericTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"uintptr": true, "byte": true, "rune": true, "float32": true, "float64": true,
+	"complex64": true, "complex128": true,
+}
+
+// zeroValueExpr 为一个返回值类型合成其零值的源码文本，用于`if x == nil { return ... }`防护。
+func zeroValueExpr(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.StarExpr, *ast.ArrayType, *ast.MapType, *ast.InterfaceType, *ast.FuncType, *ast.ChanType:
+		return "nil"
+	case *ast.Ident:
+		switch {
+		case t.Name == "string":
+			return `""`
+		case t.Name == "bool":
+			return "false"
+		case t.Name == "error":
+			return "nil"
+		case basicNumericTypes[t.Name]:
+			return "0"
+		default:
+			// t可能命名一个interface/func/chan类型，此时`T{}`不是合法的复合字面量；
+			// 没有类型信息无法区分它和struct类型，因此统一使用对任何类型都成立的`*new(T)`。
+			return fmt.Sprintf("*new(%s)", t.Name)
+		}
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("*new(%s)", exprString(t))
+	default:
+		return fmt.Sprintf("*new(%s)", exprString(t))
+	}
+}
+
+// zeroReturn 为results（最内层函数/闭包的返回值列表）合成一条匹配的`return`语句文本。
+func zeroReturn(results *ast.FieldList) string {
+	if results == nil {
+		return "return"
+	}
+	var zeroVals []string
+	for _, field := range results.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			zeroVals = append(zeroVals, zeroValueExpr(field.Type))
+		}
+	}
+	if len(zeroVals) == 0 {
+		return "return"
+	}
+	return "return " + strings.Join(zeroVals, ", ")
+}
+
+// missingNilGuardFix 在stmt之前插入一条`if varName == nil { <zero-value return> }`防护语句。
+// results是stmt所在的最内层函数/闭包的返回值列表（见innermostFuncType）。
+func missingNilGuardFix(results *ast.FieldList, stmt ast.Stmt, varName string) *analysis.SuggestedFix {
+	guard := fmt.Sprintf("if %s == nil {\n\t%s\n}\n", varName, zeroReturn(results))
+	return &analysis.SuggestedFix{
+		Message: fmt.Sprintf("在解引用前插入对`%s`的nil防护", varName),
+		TextEdits: []analysis.TextEdit{{
+			Pos:     stmt.Pos(),
+			End:     stmt.Pos(),
+			NewText: []byte(guard),
+		}},
+	}
+}
+
+// freshOkName 返回一个在fd中未被使用过的标识符名，优先使用"ok"，
+// 在`ok`已经被占用（例如已存在同名变量）时依次尝试"ok2"、"ok3"……避免改写后的代码
+// 遮蔽或重声明已有的`ok`。
+func freshOkName(fd *ast.FuncDecl) string {
+	used := make(map[string]bool)
+	ast.Inspect(fd, func(n ast.Node) bool {
+		if id, isIdent := n.(*ast.Ident); isIdent {
+			used[id.Name] = true
+		}
+		return true
+	})
+
+	name := "ok"
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("ok%d", i)
+	}
+	return name
+}
+
+// mapOkCheckFix 将`v := m[k]`形式的map读取改写为`v, <ok名> := m[k]`，并在其后插入
+// `if !<ok名> { ... }`。若assign不是这种形状（包括不是`:=`声明，因为`=`赋值无法安全地
+// 新增一个变量；或者索引对象根本不是map，因为slice/array的索引没有comma-ok形式），
+// 返回nil，调用方应退回到missingNilGuardFix。
+func mapOkCheckFix(pass *analysis.Pass, fd *ast.FuncDecl, results *ast.FieldList, assign *ast.AssignStmt) *analysis.SuggestedFix {
+	if assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil
+	}
+	idx, ok := assign.Rhs[0].(*ast.IndexExpr)
+	if !ok || !isMapIndex(pass, idx) {
+		return nil
+	}
+
+	okName := freshOkName(fd)
+	newAssign := fmt.Sprintf("%s, %s := %s", exprString(assign.Lhs[0]), okName, exprString(assign.Rhs[0]))
+	guard := fmt.Sprintf("\nif !%s {\n\t%s\n}", okName, zeroReturn(results))
+	return &analysis.SuggestedFix{
+		Message: "改写为带ok检查的map读取",
+		TextEdits: []analysis.TextEdit{
+			{Pos: assign.Pos(), End: assign.End(), NewText: []byte(newAssign)},
+			{Pos: assign.End(), End: assign.End(), NewText: []byte(guard)},
+		},
+	}
+}
+
+// typeAssertOkCheckFix 将`x := i.(T)`形式的类型断言改写为`x, <ok名> := i.(T)`，
+// 并在其后插入`if !<ok名> { ... }`。若assign不是这种形状，返回nil。
+func typeAssertOkCheckFix(fd *ast.FuncDecl, results *ast.FieldList, assign *ast.AssignStmt) *analysis.SuggestedFix {
+	if assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil
+	}
+	if _, ok := assign.Rhs[0].(*ast.TypeAssertExpr); !ok {
+		return nil
+	}
+
+	okName := freshOkName(fd)
+	newAssign := fmt.Sprintf("%s, %s := %s", exprString(assign.Lhs[0]), okName, exprString(assign.Rhs[0]))
+	guard := fmt.Sprintf("\nif !%s {\n\t%s\n}", okName, zeroReturn(results))
+	return &analysis.SuggestedFix{
+		Message: "改写为带ok检查的类型断言",
+		TextEdits: []analysis.TextEdit{
+			{Pos: assign.Pos(), End: assign.End(), NewText: []byte(newAssign)},
+			{Pos: assign.End(), End: assign.End(), NewText: []byte(guard)},
+		},
+	}
+}
+
+// SuggestedFixes 为一个冲突计算出零个或一个可机械应用的修复建议，由调用方（在`-nilaway-fix`
+// 标志开启时）附加到对应的analysis.Diagnostic.SuggestedFixes上，供gopls/`go vet -fix`应用。
+// cwd与groupConflicts中的用法一致，用于将文件的绝对路径转换为与c.position可比较的相对路径。
+func SuggestedFixes(pass *analysis.Pass, c conflict, cwd string) []analysis.SuggestedFix {
+	if len(c.flow.nonnilPath) == 0 {
+		return nil
+	}
+	last := c.flow.nonnilPath[len(c.flow.nonnilPath)-1]
+	varName, ok := extractIdentifier(last.consumerRepr)
+	if !ok {
+		varName, ok = extractIdentifier(last.producerRepr)
+	}
+	if !ok {
+		return nil
+	}
+
+	fd := enclosingFuncDecl(pass, cwd, c.position)
+	if fd == nil {
+		return nil
+	}
+	// c.position是解引用/使用发生的地方。我们真正要改写的是引入varName的那条`:=`语句，
+	// 所以先定位解引用语句以获得回溯的上界偏移量，再从那里往回找定义语句。
+	derefStmt := enclosingStmt(pass, fd, c.position)
+	if derefStmt == nil {
+		return nil
+	}
+	// 解引用可能发生在嵌套闭包内部，而闭包的返回值签名可能与fd本身完全不同，
+	// 所以用闭包自己的返回值列表合成`return`，而不是一律使用fd的。
+	results := innermostFuncType(pass, fd, c.position)
+
+	if def := definingStmt(pass, fd, varName, pass.Fset.Position(derefStmt.Pos()).Offset); def != nil {
+		if fix := mapOkCheckFix(pass, fd, results, def); fix != nil {
+			return []analysis.SuggestedFix{*fix}
+		}
+		if fix := typeAssertOkCheckFix(fd, results, def); fix != nil {
+			return []analysis.SuggestedFix{*fix}
+		}
+	}
+	return []analysis.SuggestedFix{*missingNilGuardFix(results, derefStmt, varName)}
+}
@@ -0,0 +1,59 @@
+//  版权 (c) 2023 Uber Technologies, Inc.
+//
+// 根据Apache许可证2.0版本（“许可证”）获得许可；
+// 除非符合许可证，否则您不得使用此文件。
+// 您可以在以下位置获取许可证副本：
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 除非适用法律要求或书面同意，否则软件
+// 按“原样”分发，不提供任何明示或暗示的保证或条件。
+// 请参阅许可证以了解管理权限和限制的特定语言。
+
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OutputMode 描述`-nilaway-output`标志请求的输出目标：除了默认的`analysis.Pass.Report`之外，
+// 还可以额外将所有包的冲突合并写出为一种结构化格式（目前只支持SARIF）。
+type OutputMode struct {
+	// Format 是结构化输出的格式，目前唯一支持的值是"sarif"。
+	Format string
+	// Path 是写出文件的目标路径。
+	Path string
+}
+
+// ParseOutputFlag 解析`-nilaway-output`标志的值，形如`sarif:path.sarif`。
+// 由于目前只支持一种格式，冒号之前的部分必须恰好是"sarif"；空字符串表示未启用额外输出。
+func ParseOutputFlag(value string) (OutputMode, error) {
+	if value == "" {
+		return OutputMode{}, nil
+	}
+
+	format, path, ok := strings.Cut(value, ":")
+	if !ok || path == "" {
+		return OutputMode{}, fmt.Errorf("nilaway-output: 期望格式为\"<format>:<path>\"，实际得到%q", value)
+	}
+	if format != "sarif" {
+		return OutputMode{}, fmt.Errorf("nilaway-output: 不支持的格式%q（目前只支持\"sarif\"）", format)
+	}
+
+	return OutputMode{Format: format, Path: path}, nil
+}
+
+// Write 根据OutputMode将合并后的冲突写出到对应格式的文件中。若m为零值（未启用额外输出），
+// Write不做任何事情。Flush在所有包分析完成、合并了各包通过Collect提交的冲突后调用一次本方法。
+func (m OutputMode) Write(allConflicts []conflict) error {
+	if m.Format == "" {
+		return nil
+	}
+	switch m.Format {
+	case "sarif":
+		return WriteSarif(allConflicts, m.Path)
+	default:
+		return fmt.Errorf("nilaway-output: 不支持的格式%q", m.Format)
+	}
+}
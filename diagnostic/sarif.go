@@ -0,0 +1,198 @@
+//  版权 (c) 2023 Uber Technologies, Inc.
+//
+// 根据Apache许可证2.0版本（“许可证”）获得许可；
+// 除非符合许可证，否则您不得使用此文件。
+// 您可以在以下位置获取许可证副本：
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 除非适用法律要求或书面同意，否则软件
+// 按“原样”分发，不提供任何明示或暗示的保证或条件。
+// 请参阅许可证以了解管理权限和限制的特定语言。
+
+package diagnostic
+
+import (
+	"encoding/json"
+	"go/token"
+	"os"
+	"path/filepath"
+)
+
+// sarifSchemaURI 和 sarifVersion 标识我们生成的日志所遵循的SARIF规范版本。
+const (
+	sarifSchemaURI = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+	sarifVersion   = "2.1.0"
+
+	// toolName 是写入SARIF工具组件的NilAway名称，供GitHub code scanning等消费方展示。
+	toolName = "NilAway"
+
+	// ruleSingleAssertion 和 ruleNilFlow 是我们发出的冲突种类对应的稳定规则ID。
+	ruleSingleAssertion = "NILAWAY_SINGLE_ASSERTION"
+	ruleNilFlow         = "NILAWAY_NIL_FLOW"
+)
+
+// sarifLog 是SARIF 2.1.0日志文件的根对象。
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun 对应一次分析运行；我们将所有包的冲突合并到单个run中。
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifToolComponent `json:"driver"`
+}
+
+type sarifToolComponent struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+// sarifResult 是单个冲突（包括其分组的相似冲突）在SARIF中的表示。
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// ruleID 根据冲突的种类返回稳定的规则ID：没有nil路径、只有一步non-nil路径的是单一断言冲突，
+// 其余（经过完整nil流传播得到的）归为nil流冲突。
+func ruleID(c conflict) string {
+	if len(c.flow.nilPath) == 0 && len(c.flow.nonnilPath) == 1 {
+		return ruleSingleAssertion
+	}
+	return ruleNilFlow
+}
+
+// sarifLocationFromPosition 将一个token.Position转换为SARIF的物理位置。行列号均为1起始，
+// 而token.Position本身已经是1起始的，因此无需转换。
+func sarifLocationFromPosition(pos token.Position) sarifLocation {
+	return sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(pos.Filename)},
+			Region: sarifRegion{
+				StartLine:   pos.Line,
+				StartColumn: pos.Column,
+			},
+		},
+	}
+}
+
+// relatedLocationsFor 收集一个冲突的相关位置：其nil路径和non-nil路径上的每个节点，
+// 以及每个相似冲突的解引用位置（即该相似冲突non-nil路径最后一个节点的消费者位置）。
+func relatedLocationsFor(c conflict) []sarifLocation {
+	var locs []sarifLocation
+	for _, n := range c.flow.nilPath {
+		if n.producerPosition.IsValid() {
+			locs = append(locs, sarifLocationFromPosition(n.producerPosition))
+		}
+		if n.consumerPosition.IsValid() {
+			locs = append(locs, sarifLocationFromPosition(n.consumerPosition))
+		}
+	}
+	for _, n := range c.flow.nonnilPath {
+		if n.producerPosition.IsValid() {
+			locs = append(locs, sarifLocationFromPosition(n.producerPosition))
+		}
+		if n.consumerPosition.IsValid() {
+			locs = append(locs, sarifLocationFromPosition(n.consumerPosition))
+		}
+	}
+	for _, similar := range c.similarConflicts {
+		if len(similar.flow.nonnilPath) == 0 {
+			continue
+		}
+		derefSite := similar.flow.nonnilPath[len(similar.flow.nonnilPath)-1]
+		if derefSite.consumerPosition.IsValid() {
+			locs = append(locs, sarifLocationFromPosition(derefSite.consumerPosition))
+		}
+	}
+	return locs
+}
+
+// toSarifResult 将一个（已分组的）冲突转换为一条SARIF result。
+func toSarifResult(c conflict) sarifResult {
+	return sarifResult{
+		RuleID:           ruleID(c),
+		Level:            "warning",
+		Message:          sarifMessage{Text: c.String()},
+		Locations:        []sarifLocation{sarifLocationFromPosition(c.position)},
+		RelatedLocations: relatedLocationsFor(c),
+	}
+}
+
+// WriteSarif 将一组（跨所有包合并后的）冲突序列化为单个SARIF 2.1.0日志并写入path。
+// 这是`-nilaway-output=sarif:path.sarif`标志的落地点：Flush在所有包分析完成后，
+// 合并各包通过Collect提交的冲突，并经由OutputMode.Write调用此函数一次。
+func WriteSarif(allConflicts []conflict, path string) error {
+	results := make([]sarifResult, 0, len(allConflicts))
+	seenRules := map[string]bool{}
+	var rules []sarifRule
+	for _, c := range allConflicts {
+		results = append(results, toSarifResult(c))
+		id := ruleID(c)
+		if !seenRules[id] {
+			seenRules[id] = true
+			rules = append(rules, sarifRule{ID: id})
+		}
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchemaURI,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{
+				Driver: sarifToolComponent{
+					Name:  toolName,
+					Rules: rules,
+				},
+			},
+			Results: results,
+		}},
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}